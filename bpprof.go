@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -97,8 +98,24 @@ func printStackRecord(w io.Writer, stk []uintptr, allFrames bool) {
 	fmt.Fprintf(w, "\n")
 }
 
-// Based on: https://github.com/golang/go/blob/6b8762104a90c93ebd51149e7a031738832c5cdc/src/runtime/pprof/pprof.go#L387
-func Heap(w http.ResponseWriter, r *http.Request) {
+// stack0Hash hashes a MemProfileRecord's raw stack the same way the runtime
+// does internally, so that records sharing a call stack can be merged.
+// Based on: https://github.com/golang/go/blob/f9ed2f75c43cb8745a1593ec3e4208c46419216a/src/runtime/mprof.go#L150
+func stack0Hash(stack0 [32]uintptr) uintptr {
+	var h uintptr
+	for _, pc := range stack0 {
+		h += pc
+		h += h << 10
+		h ^= h >> 6
+	}
+	h += h << 3
+	h ^= h >> 11
+	return h
+}
+
+// aggregatedMemProfile fetches the current heap profile and merges records
+// that share a call stack into one, the same way Heap has always done.
+func aggregatedMemProfile() []runtime.MemProfileRecord {
 	var p []runtime.MemProfileRecord
 	n, ok := runtime.MemProfile(nil, true)
 	for {
@@ -117,15 +134,7 @@ func Heap(w http.ResponseWriter, r *http.Request) {
 	pm := make(map[uintptr]runtime.MemProfileRecord, len(p))
 
 	for _, r := range p {
-		// Based on: https://github.com/golang/go/blob/f9ed2f75c43cb8745a1593ec3e4208c46419216a/src/runtime/mprof.go#L150
-		var h uintptr
-		for _, pc := range r.Stack0 {
-			h += pc
-			h += h << 10
-			h ^= h >> 6
-		}
-		h += h << 3
-		h ^= h >> 11
+		h := stack0Hash(r.Stack0)
 
 		if _, ok := pm[h]; ok {
 			r.AllocBytes += pm[h].AllocBytes
@@ -142,7 +151,56 @@ func Heap(w http.ResponseWriter, r *http.Request) {
 		p = append(p, r)
 	}
 
-	switch r.FormValue("sort") {
+	return p
+}
+
+// Heap writes the current heap profile to w in the format and sort order
+// requested by r's query parameters. It is a thin net/http wrapper around
+// HeapTo; see Options for the parameters it recognizes.
+//
+// Based on: https://github.com/golang/go/blob/6b8762104a90c93ebd51149e7a031738832c5cdc/src/runtime/pprof/pprof.go#L387
+func Heap(w http.ResponseWriter, r *http.Request) {
+	opts := Options{
+		Sort:     r.FormValue("sort"),
+		Format:   r.FormValue("format"),
+		Include:  r.FormValue("include"),
+		Exclude:  r.FormValue("exclude"),
+		Snapshot: r.FormValue("snapshot"),
+		Diff:     r.FormValue("diff"),
+	}
+	if s := r.FormValue("top"); s != "" {
+		opts.Top, _ = strconv.Atoi(s)
+	}
+	if s := r.FormValue("min_bytes"); s != "" {
+		opts.MinBytes, _ = strconv.ParseInt(s, 10, 64)
+	}
+
+	if opts.Format == "proto" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
+	HeapTo(w, opts)
+}
+
+// HeapTo writes the current heap profile to w according to opts. Unlike
+// Heap it takes no dependency on net/http, so it can be driven by any
+// transport - see the bpprof/fasthttp sub-package for one example.
+func HeapTo(w io.Writer, opts Options) error {
+	if opts.Format == "proto" {
+		return HeapProto(w)
+	}
+
+	p := aggregatedMemProfile()
+
+	if opts.Snapshot != "" {
+		SaveSnapshot(opts.Snapshot)
+	}
+	if opts.Diff != "" {
+		p = diffSnapshot(opts.Diff, p)
+	}
+
+	switch opts.Sort {
 	default:
 		sort.Sort(byInUseBytes(p))
 	case "allocbytes":
@@ -153,6 +211,11 @@ func Heap(w http.ResponseWriter, r *http.Request) {
 		sort.Sort(byInUseObjects(p))
 	}
 
+	filtered, err := filterHeapRecords(opts, p)
+	if err != nil {
+		return err
+	}
+
 	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
 
 	var total runtime.MemProfileRecord
@@ -176,17 +239,22 @@ func Heap(w http.ResponseWriter, r *http.Request) {
 		total.AllocObjects, formatSize(total.AllocBytes),
 		2*runtime.MemProfileRate)
 
-	for _, r := range p {
+	if len(filtered) != len(p) {
+		fmt.Fprintf(tw, "# showing %d of %d stacks after top/min_bytes/include/exclude filtering\n\n", len(filtered), len(p))
+	}
+	p = filtered
+
+	for _, rec := range p {
 		fmt.Fprintf(tw, "%d: %d [%d: %d] @",
-			r.InUseObjects(), r.InUseBytes(),
-			r.AllocObjects, r.AllocBytes)
-		for _, pc := range r.Stack() {
+			rec.InUseObjects(), rec.InUseBytes(),
+			rec.AllocObjects, rec.AllocBytes)
+		for _, pc := range rec.Stack() {
 			fmt.Fprintf(tw, " %#x", pc)
 		}
 		fmt.Fprintf(tw, "\n# %d: %s [%d: %s]\n",
-			r.InUseObjects(), formatSize(r.InUseBytes()),
-			r.AllocObjects, formatSize(r.AllocBytes))
-		printStackRecord(tw, r.Stack(), false)
+			rec.InUseObjects(), formatSize(rec.InUseBytes()),
+			rec.AllocObjects, formatSize(rec.AllocBytes))
+		printStackRecord(tw, rec.Stack(), false)
 	}
 
 	// Print memstats information too.
@@ -240,7 +308,5 @@ func Heap(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(tw, "# EnableGC = %v\n", s.EnableGC)
 	fmt.Fprintf(tw, "# DebugGC = %v\n", s.DebugGC)
 
-	if tw != nil {
-		tw.Flush()
-	}
+	return tw.Flush()
 }
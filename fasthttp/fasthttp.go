@@ -0,0 +1,96 @@
+// Package fasthttp adapts bpprof's profile handlers to valyala/fasthttp,
+// for servers that don't use net/http. Each handler extracts Heap's full
+// set of query parameters (sort, format, include, exclude, snapshot, diff,
+// top and min_bytes) from a *fasthttp.RequestCtx, and renders the profile
+// through the transport-agnostic *To functions in the root bpprof package.
+// Allocs therefore honors all of them, while bpprof.Allocs reads only sort.
+package fasthttp
+
+import (
+	"strconv"
+
+	"github.com/erikdubbelboer/bpprof"
+	"github.com/valyala/fasthttp"
+)
+
+func optionsFromCtx(ctx *fasthttp.RequestCtx) bpprof.Options {
+	opts := bpprof.Options{
+		Sort:     string(ctx.FormValue("sort")),
+		Format:   string(ctx.FormValue("format")),
+		Include:  string(ctx.FormValue("include")),
+		Exclude:  string(ctx.FormValue("exclude")),
+		Snapshot: string(ctx.FormValue("snapshot")),
+		Diff:     string(ctx.FormValue("diff")),
+	}
+	if v := ctx.FormValue("top"); len(v) > 0 {
+		opts.Top, _ = strconv.Atoi(string(v))
+	}
+	if v := ctx.FormValue("min_bytes"); len(v) > 0 {
+		opts.MinBytes, _ = strconv.ParseInt(string(v), 10, 64)
+	}
+	return opts
+}
+
+// Heap writes the current heap profile to ctx, honoring the same query
+// parameters as bpprof.Heap.
+func Heap(ctx *fasthttp.RequestCtx) {
+	opts := optionsFromCtx(ctx)
+	if opts.Format == "proto" {
+		ctx.SetContentType("application/octet-stream")
+		ctx.Response.Header.Set("Content-Encoding", "gzip")
+	}
+	bpprof.HeapTo(ctx, opts)
+}
+
+// Allocs writes the current heap profile to ctx, defaulting to sorting by
+// allocated bytes; see bpprof.Allocs.
+func Allocs(ctx *fasthttp.RequestCtx) {
+	bpprof.AllocsTo(ctx, optionsFromCtx(ctx))
+}
+
+// Goroutine writes the current goroutine profile to ctx; see
+// bpprof.Goroutine.
+func Goroutine(ctx *fasthttp.RequestCtx) {
+	bpprof.GoroutineTo(ctx, optionsFromCtx(ctx))
+}
+
+// Block writes the current blocking profile to ctx; see bpprof.Block.
+func Block(ctx *fasthttp.RequestCtx) {
+	bpprof.BlockTo(ctx, optionsFromCtx(ctx))
+}
+
+// Mutex writes the current contended-mutex profile to ctx; see
+// bpprof.Mutex.
+func Mutex(ctx *fasthttp.RequestCtx) {
+	bpprof.MutexTo(ctx, optionsFromCtx(ctx))
+}
+
+// ThreadCreate writes the current thread-creation profile to ctx; see
+// bpprof.ThreadCreate.
+func ThreadCreate(ctx *fasthttp.RequestCtx) {
+	bpprof.ThreadCreateTo(ctx, optionsFromCtx(ctx))
+}
+
+// RequestHandler is a fasthttp.RequestHandler serving the heap, allocs,
+// goroutine, block, mutex and threadcreate paths under /debug/bpprof/, for
+// servers that don't use a router. The /debug/bpprof/history and
+// /debug/bpprof/metrics paths that the net/http package registers are not
+// served here; they, like any other path, get NotFound.
+func RequestHandler(ctx *fasthttp.RequestCtx) {
+	switch string(ctx.Path()) {
+	case "/debug/bpprof/heap":
+		Heap(ctx)
+	case "/debug/bpprof/allocs":
+		Allocs(ctx)
+	case "/debug/bpprof/goroutine":
+		Goroutine(ctx)
+	case "/debug/bpprof/block":
+		Block(ctx)
+	case "/debug/bpprof/mutex":
+		Mutex(ctx)
+	case "/debug/bpprof/threadcreate":
+		ThreadCreate(ctx)
+	default:
+		ctx.NotFound()
+	}
+}
@@ -1,3 +1,5 @@
+// +build ignore
+
 package main
 
 import (
@@ -9,7 +11,7 @@ import (
 
 	_ "net/http/pprof"
 
-	"github.com/erikdubbelboer/bpprof"
+	bpprofhttp "github.com/erikdubbelboer/bpprof/fasthttp"
 	"github.com/valyala/fasthttp"
 )
 
@@ -34,9 +36,8 @@ func main() {
 	log.Println(
 		fasthttp.ListenAndServe("0.0.0.0:6060",
 			func(ctx *fasthttp.RequestCtx) {
-				if strings.HasPrefix(string(ctx.Path()), "/debug/bpprof/heap") {
-					runtime.GC() // Trigger a GC to get an accurate dump.
-					bpprof.Heap(ctx, string(ctx.FormValue("sort")))
+				if strings.HasPrefix(string(ctx.Path()), "/debug/bpprof/") {
+					bpprofhttp.RequestHandler(ctx)
 				} else {
 					exampleHandler(ctx)
 				}
@@ -0,0 +1,76 @@
+package bpprof
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// topFrameName returns the function name of the first non-runtime frame in
+// stack, falling back to the very first frame if the whole stack is inside
+// the runtime package. This is the frame include/exclude filtering matches
+// against, since it's usually the most meaningful one for a human reading
+// the profile.
+func topFrameName(stack []uintptr) string {
+	var first string
+	for _, pc := range stack {
+		f := runtime.FuncForPC(pc)
+		if f == nil {
+			continue
+		}
+		name := f.Name()
+		if first == "" {
+			first = name
+		}
+		if !strings.HasPrefix(name, "runtime.") {
+			return name
+		}
+	}
+	return first
+}
+
+// filterHeapRecords applies opts' Top, MinBytes, Include and Exclude
+// settings to an already-sorted slice of records, returning the subset
+// that should actually be printed. p must already be sorted, since Top is
+// applied last and simply truncates. It returns an error if Include or
+// Exclude isn't a valid regexp, rather than silently treating the filter as
+// a no-op.
+func filterHeapRecords(opts Options, p []runtime.MemProfileRecord) ([]runtime.MemProfileRecord, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+	if opts.Include != "" {
+		if include, err = regexp.Compile(opts.Include); err != nil {
+			return nil, fmt.Errorf("bpprof: invalid include regexp: %w", err)
+		}
+	}
+	if opts.Exclude != "" {
+		if exclude, err = regexp.Compile(opts.Exclude); err != nil {
+			return nil, fmt.Errorf("bpprof: invalid exclude regexp: %w", err)
+		}
+	}
+
+	if include != nil || exclude != nil || opts.MinBytes > 0 {
+		filtered := make([]runtime.MemProfileRecord, 0, len(p))
+		for _, rec := range p {
+			if rec.InUseBytes() < opts.MinBytes {
+				continue
+			}
+			name := topFrameName(rec.Stack())
+			if include != nil && !include.MatchString(name) {
+				continue
+			}
+			if exclude != nil && exclude.MatchString(name) {
+				continue
+			}
+			filtered = append(filtered, rec)
+		}
+		p = filtered
+	}
+
+	if opts.Top > 0 && opts.Top < len(p) {
+		p = p[:opts.Top]
+	}
+
+	return p, nil
+}
@@ -1,3 +1,11 @@
+// Package http exposes bpprof's handlers under their own import, for callers
+// that don't want to name the bpprof root package directly (e.g. because
+// they also vendor net/http/pprof and want to keep the two apart in their
+// import list). Importing this package also imports the bpprof root package,
+// whose own init already registers these same patterns on
+// http.DefaultServeMux, so this package does not register them again; it
+// only exists to hand callers these handlers under its own name for mounting
+// on a custom mux.
 package http
 
 import (
@@ -6,10 +14,32 @@ import (
 	"github.com/erikdubbelboer/bpprof"
 )
 
-func init() {
-	http.Handle("/debug/bpprof/heap", http.HandlerFunc(heap))
+// Heap is bpprof.Heap under this package's name.
+func Heap(w http.ResponseWriter, r *http.Request) {
+	bpprof.Heap(w, r)
 }
 
-func heap(w http.ResponseWriter, r *http.Request) {
-	bpprof.Heap(w, r.FormValue("sort"))
+// Allocs is bpprof.Allocs under this package's name.
+func Allocs(w http.ResponseWriter, r *http.Request) {
+	bpprof.Allocs(w, r)
+}
+
+// Goroutine is bpprof.Goroutine under this package's name.
+func Goroutine(w http.ResponseWriter, r *http.Request) {
+	bpprof.Goroutine(w, r)
+}
+
+// Block is bpprof.Block under this package's name.
+func Block(w http.ResponseWriter, r *http.Request) {
+	bpprof.Block(w, r)
+}
+
+// Mutex is bpprof.Mutex under this package's name.
+func Mutex(w http.ResponseWriter, r *http.Request) {
+	bpprof.Mutex(w, r)
+}
+
+// ThreadCreate is bpprof.ThreadCreate under this package's name.
+func ThreadCreate(w http.ResponseWriter, r *http.Request) {
+	bpprof.ThreadCreate(w, r)
 }
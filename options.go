@@ -0,0 +1,41 @@
+package bpprof
+
+// Options controls how a profile is rendered, independent of how it was
+// requested (net/http, fasthttp, or any other transport). The net/http
+// profile handlers in this package (Heap, Allocs, Goroutine, Block, Mutex
+// and ThreadCreate) build an Options from the incoming request's query
+// parameters and then call the corresponding *To function (HeapTo,
+// AllocsTo, and so on); other transports, such as the bpprof/fasthttp sub-package, do the same
+// from their own request type.
+type Options struct {
+	// Sort selects the sort order. Valid values depend on the profile:
+	// heap/allocs accept "inusebytes", "allocbytes", "allocobjects" and
+	// "inuseobjects", defaulting to "inusebytes" for heap and "allocbytes"
+	// for allocs; block/mutex accept "cycles" (default) and "count".
+	Sort string
+
+	// Format selects the output encoding. The empty string means the
+	// legacy human-readable text format; "proto" means a gzipped
+	// profile.proto Profile message. Only used by Heap/HeapTo.
+	Format string
+
+	// Top, when non-zero, limits the output to the first N records after
+	// sorting and filtering. Only used by Heap/HeapTo.
+	Top int
+
+	// MinBytes drops records whose InUseBytes is below this value. Only
+	// used by Heap/HeapTo.
+	MinBytes int64
+
+	// Include and Exclude, when non-empty, are regexes matched against
+	// each record's top non-runtime frame; Include must match and
+	// Exclude must not. Only used by Heap/HeapTo.
+	Include string
+	Exclude string
+
+	// Snapshot, when non-empty, saves the profile under this name before
+	// rendering it. Diff, when non-empty, subtracts the named snapshot
+	// from the profile before rendering it. Only used by Heap/HeapTo.
+	Snapshot string
+	Diff     string
+}
@@ -0,0 +1,210 @@
+package bpprof
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+)
+
+func init() {
+	http.Handle("/debug/bpprof/goroutine", http.HandlerFunc(Goroutine))
+	http.Handle("/debug/bpprof/allocs", http.HandlerFunc(Allocs))
+	http.Handle("/debug/bpprof/block", http.HandlerFunc(Block))
+	http.Handle("/debug/bpprof/mutex", http.HandlerFunc(Mutex))
+	http.Handle("/debug/bpprof/threadcreate", http.HandlerFunc(ThreadCreate))
+}
+
+// Allocs writes the same aggregated heap profile as Heap, but defaults to
+// sorting by allocated (rather than in-use) bytes, matching the way
+// net/http/pprof's /allocs differs from /heap: both read from
+// runtime.MemProfile, only the default presentation differs.
+func Allocs(w http.ResponseWriter, r *http.Request) {
+	opts := Options{Sort: r.FormValue("sort")}
+	AllocsTo(w, opts)
+}
+
+// AllocsTo is the io.Writer-based counterpart of Allocs; see HeapTo.
+func AllocsTo(w io.Writer, opts Options) error {
+	if opts.Sort == "" {
+		opts.Sort = "allocbytes"
+	}
+	return HeapTo(w, opts)
+}
+
+type byCycles []runtime.BlockProfileRecord
+
+func (x byCycles) Len() int           { return len(x) }
+func (x byCycles) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byCycles) Less(i, j int) bool { return x[i].Cycles > x[j].Cycles }
+
+type byContentions []runtime.BlockProfileRecord
+
+func (x byContentions) Len() int           { return len(x) }
+func (x byContentions) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byContentions) Less(i, j int) bool { return x[i].Count > x[j].Count }
+
+// Goroutine writes a profile of the stacks of all current goroutines, one
+// entry per distinct stack. It is a thin net/http wrapper around
+// GoroutineTo.
+func Goroutine(w http.ResponseWriter, r *http.Request) {
+	GoroutineTo(w, Options{Sort: r.FormValue("sort")})
+}
+
+// GoroutineTo is the io.Writer-based counterpart of Goroutine; see HeapTo.
+func GoroutineTo(w io.Writer, opts Options) error {
+	n := runtime.NumGoroutine()
+	var p []runtime.StackRecord
+	for {
+		p = make([]runtime.StackRecord, n+50)
+		var ok bool
+		n, ok = runtime.GoroutineProfile(p)
+		if ok {
+			p = p[0:n]
+			break
+		}
+	}
+
+	// Merge goroutines that share a stack into one entry, counting them.
+	counts := make(map[[32]uintptr]int, len(p))
+	var stacks []runtime.StackRecord
+	for _, r := range p {
+		if counts[r.Stack0] == 0 {
+			stacks = append(stacks, r)
+		}
+		counts[r.Stack0]++
+	}
+
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+
+	fmt.Fprintf(tw, "goroutine profile: total %d\n\n", len(p))
+
+	for _, r := range stacks {
+		fmt.Fprintf(tw, "%d @", counts[r.Stack0])
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(tw, " %#x", pc)
+		}
+		fmt.Fprintf(tw, "\n")
+		printStackRecord(tw, r.Stack(), false)
+	}
+
+	return tw.Flush()
+}
+
+// ThreadCreate writes a profile of the stacks that led to the creation of
+// new OS threads, mirroring Goroutine's format. It is a thin net/http
+// wrapper around ThreadCreateTo.
+func ThreadCreate(w http.ResponseWriter, r *http.Request) {
+	ThreadCreateTo(w, Options{Sort: r.FormValue("sort")})
+}
+
+// ThreadCreateTo is the io.Writer-based counterpart of ThreadCreate; see
+// HeapTo.
+func ThreadCreateTo(w io.Writer, opts Options) error {
+	n, _ := runtime.ThreadCreateProfile(nil)
+	var p []runtime.StackRecord
+	for {
+		p = make([]runtime.StackRecord, n+50)
+		var ok bool
+		n, ok = runtime.ThreadCreateProfile(p)
+		if ok {
+			p = p[0:n]
+			break
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+
+	fmt.Fprintf(tw, "threadcreate profile: total %d\n\n", len(p))
+
+	for _, r := range p {
+		fmt.Fprintf(tw, "1 @")
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(tw, " %#x", pc)
+		}
+		fmt.Fprintf(tw, "\n")
+		printStackRecord(tw, r.Stack(), false)
+	}
+
+	return tw.Flush()
+}
+
+// blockOrMutexProfile writes the given []runtime.BlockProfileRecord out in
+// Heap's text format, honoring opts.Sort ("count" sorts by contention
+// count, anything else sorts by cycles).
+func blockOrMutexProfile(w io.Writer, opts Options, name string, p []runtime.BlockProfileRecord) error {
+	switch opts.Sort {
+	case "count":
+		sort.Sort(byContentions(p))
+	default:
+		sort.Sort(byCycles(p))
+	}
+
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+
+	var totalCycles, totalCount int64
+	for _, r := range p {
+		totalCycles += int64(r.Cycles)
+		totalCount += r.Count
+	}
+	fmt.Fprintf(tw, "%s profile: %d: %d cycles\n\n", name, totalCount, totalCycles)
+
+	for _, r := range p {
+		fmt.Fprintf(tw, "%d %d @", r.Count, int64(r.Cycles))
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(tw, " %#x", pc)
+		}
+		fmt.Fprintf(tw, "\n")
+		printStackRecord(tw, r.Stack(), false)
+	}
+
+	return tw.Flush()
+}
+
+// Block writes a profile of stack traces that led to blocking on
+// synchronization primitives, as sampled at runtime.SetBlockProfileRate.
+// It is a thin net/http wrapper around BlockTo.
+func Block(w http.ResponseWriter, r *http.Request) {
+	BlockTo(w, Options{Sort: r.FormValue("sort")})
+}
+
+// BlockTo is the io.Writer-based counterpart of Block; see HeapTo.
+func BlockTo(w io.Writer, opts Options) error {
+	n, _ := runtime.BlockProfile(nil)
+	var p []runtime.BlockProfileRecord
+	for {
+		p = make([]runtime.BlockProfileRecord, n+50)
+		var ok bool
+		n, ok = runtime.BlockProfile(p)
+		if ok {
+			p = p[0:n]
+			break
+		}
+	}
+	return blockOrMutexProfile(w, opts, "block", p)
+}
+
+// Mutex writes a profile of stack traces of holders of contended mutexes,
+// as sampled at runtime.SetMutexProfileFraction. It is a thin net/http
+// wrapper around MutexTo.
+func Mutex(w http.ResponseWriter, r *http.Request) {
+	MutexTo(w, Options{Sort: r.FormValue("sort")})
+}
+
+// MutexTo is the io.Writer-based counterpart of Mutex; see HeapTo.
+func MutexTo(w io.Writer, opts Options) error {
+	n, _ := runtime.MutexProfile(nil)
+	var p []runtime.BlockProfileRecord
+	for {
+		p = make([]runtime.BlockProfileRecord, n+50)
+		var ok bool
+		n, ok = runtime.MutexProfile(p)
+		if ok {
+			p = p[0:n]
+			break
+		}
+	}
+	return blockOrMutexProfile(w, opts, "mutex", p)
+}
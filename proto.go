@@ -0,0 +1,250 @@
+package bpprof
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"runtime"
+)
+
+// protobuf is a very small encoder for the subset of the protobuf wire
+// format needed to emit a pprof profile.proto Profile message. Writing it
+// by hand avoids pulling in a protobuf dependency for a handful of
+// messages, mirroring the approach runtime/pprof itself takes internally.
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) tag(field int, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// int64Field writes a varint-encoded int64 field, skipping zero values as
+// proto3 does.
+func (b *protobuf) int64Field(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.tag(field, 0)
+	b.varint(uint64(x))
+}
+
+func (b *protobuf) int64s(field int, xs []int64) {
+	if len(xs) == 0 {
+		return
+	}
+	// Packed repeated varint field.
+	var inner protobuf
+	for _, x := range xs {
+		inner.varint(uint64(x))
+	}
+	b.tag(field, 2)
+	b.varint(uint64(len(inner.data)))
+	b.data = append(b.data, inner.data...)
+}
+
+func (b *protobuf) string(field int, s string) {
+	b.tag(field, 2)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protobuf) bytes(field int, bs []byte) {
+	b.tag(field, 2)
+	b.varint(uint64(len(bs)))
+	b.data = append(b.data, bs...)
+}
+
+func (b *protobuf) message(field int, m *protobuf) {
+	b.tag(field, 2)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+// profileBuilder accumulates the string table and Location/Function tables
+// needed to emit a pprof Profile message, deduplicating as it goes.
+type profileBuilder struct {
+	strings   []string
+	stringIdx map[string]int64
+
+	locations   []*protobuf
+	locationIdx map[uintptr]uint64
+
+	functions   []*protobuf
+	functionIdx map[string]uint64
+
+	mapping *protobuf
+}
+
+func newProfileBuilder() *profileBuilder {
+	pb := &profileBuilder{
+		stringIdx:   make(map[string]int64),
+		locationIdx: make(map[uintptr]uint64),
+		functionIdx: make(map[string]uint64),
+	}
+	// Index 0 of the string table is always the empty string.
+	pb.addString("")
+	return pb
+}
+
+func (pb *profileBuilder) addString(s string) int64 {
+	if idx, ok := pb.stringIdx[s]; ok {
+		return idx
+	}
+	idx := int64(len(pb.strings))
+	pb.strings = append(pb.strings, s)
+	pb.stringIdx[s] = idx
+	return idx
+}
+
+func (pb *profileBuilder) functionID(name string) uint64 {
+	if id, ok := pb.functionIdx[name]; ok {
+		return id
+	}
+	id := uint64(len(pb.functions) + 1)
+	pb.functionIdx[name] = id
+
+	var f protobuf
+	f.int64Field(1, int64(id))          // id
+	f.int64Field(2, pb.addString(name)) // name
+	f.int64Field(3, pb.addString(name)) // system_name (we don't track it separately)
+	pb.functions = append(pb.functions, &f)
+	return id
+}
+
+// mappingID returns the id of the single Mapping entry describing this
+// executable, building it the first time it is needed.
+func (pb *profileBuilder) mappingID() uint64 {
+	if pb.mapping == nil {
+		var m protobuf
+		m.int64Field(1, 1) // id
+		if name, err := os.Executable(); err == nil {
+			m.int64Field(5, pb.addString(name)) // filename
+		}
+		pb.mapping = &m
+	}
+	return 1
+}
+
+// locationID returns the Location id for pc, building Location and Function
+// table entries (deduplicated by pc and function name) the first time it is
+// seen.
+func (pb *profileBuilder) locationID(pc uintptr) uint64 {
+	if id, ok := pb.locationIdx[pc]; ok {
+		return id
+	}
+	id := uint64(len(pb.locations) + 1)
+	pb.locationIdx[pc] = id
+
+	var loc protobuf
+	loc.int64Field(1, int64(id))             // id
+	loc.int64Field(2, int64(pb.mappingID())) // mapping_id
+	loc.int64Field(3, int64(pc))             // address
+
+	if f := runtime.FuncForPC(pc); f != nil {
+		_, line := f.FileLine(pc)
+		fid := pb.functionID(f.Name())
+		loc.data = append(loc.data, encodeLine(fid, int64(line))...)
+	}
+
+	pb.locations = append(pb.locations, &loc)
+	return id
+}
+
+// encodeLine encodes a single profile.proto Line message (function_id, line)
+// as field 4 of Location.
+func encodeLine(functionID uint64, line int64) []byte {
+	var ln protobuf
+	ln.int64Field(1, int64(functionID))
+	ln.int64Field(2, line)
+
+	var wrapped protobuf
+	wrapped.message(4, &ln)
+	return wrapped.data
+}
+
+// buildHeapProfile serializes the aggregated memory profile records into a
+// profile.proto Profile message with four sample value types:
+// alloc_objects, alloc_bytes, inuse_objects and inuse_bytes.
+func buildHeapProfile(records []runtime.MemProfileRecord) []byte {
+	pb := newProfileBuilder()
+
+	var prof protobuf
+
+	valueTypes := []struct{ typ, unit string }{
+		{"alloc_objects", "count"},
+		{"alloc_bytes", "bytes"},
+		{"inuse_objects", "count"},
+		{"inuse_bytes", "bytes"},
+	}
+	for _, vt := range valueTypes {
+		var vtm protobuf
+		vtm.int64Field(1, pb.addString(vt.typ))
+		vtm.int64Field(2, pb.addString(vt.unit))
+		prof.message(1, &vtm) // sample_type
+	}
+
+	for _, r := range records {
+		var sample protobuf
+		locationIDs := make([]int64, 0, len(r.Stack0))
+		for _, pc := range r.Stack0 {
+			if pc == 0 {
+				continue
+			}
+			locationIDs = append(locationIDs, int64(pb.locationID(pc)))
+		}
+		sample.int64s(1, locationIDs) // location_id, leaf-first
+		sample.int64s(2, []int64{
+			r.AllocObjects,
+			r.AllocBytes,
+			r.InUseObjects(),
+			r.InUseBytes(),
+		})
+		prof.message(2, &sample) // sample
+	}
+
+	if pb.mapping != nil {
+		prof.message(3, pb.mapping) // mapping
+	}
+	for _, loc := range pb.locations {
+		prof.message(4, loc) // location
+	}
+	for _, fn := range pb.functions {
+		prof.message(5, fn) // function
+	}
+
+	var periodType protobuf
+	periodType.int64Field(1, pb.addString("space"))
+	periodType.int64Field(2, pb.addString("bytes"))
+	prof.message(11, &periodType)                        // period_type
+	prof.int64Field(12, int64(2*runtime.MemProfileRate)) // period
+
+	for _, s := range pb.strings {
+		prof.string(6, s) // string_table
+	}
+
+	return prof.data
+}
+
+// HeapProto writes the current, aggregated heap profile to w as a
+// gzip-compressed profile.proto Profile message, suitable for
+// `go tool pprof` and OTLP/Pyroscope-style ingesters.
+func HeapProto(w io.Writer) error {
+	records := aggregatedMemProfile()
+	data := buildHeapProfile(records)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(data); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,219 @@
+package bpprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	http.Handle("/debug/bpprof/history", http.HandlerFunc(History))
+	http.Handle("/debug/bpprof/metrics", http.HandlerFunc(Metrics))
+}
+
+// TopStack is one entry in a Sample's list of top allocating stacks.
+type TopStack struct {
+	Stack        []string `json:"stack"`
+	InUseBytes   int64    `json:"inuse_bytes"`
+	InUseObjects int64    `json:"inuse_objects"`
+}
+
+// Sample is one point in the sampler's history, combining the fields of
+// runtime.MemStats that matter for trend graphs with the top allocating
+// stacks at the time it was taken.
+type Sample struct {
+	Time        time.Time     `json:"time"`
+	Alloc       uint64        `json:"alloc"`
+	HeapInuse   uint64        `json:"heap_inuse"`
+	HeapObjects uint64        `json:"heap_objects"`
+	NextGC      uint64        `json:"next_gc"`
+	NumGC       uint32        `json:"num_gc"`
+	GCPause     time.Duration `json:"gc_pause"`
+	Top         []TopStack    `json:"top"`
+}
+
+var (
+	samplerMu        sync.Mutex
+	samplerHistory   []Sample
+	samplerKeep      int
+	samplerStop      chan struct{}
+	samplerPrevNumGC uint32
+)
+
+// StartSampler starts a background goroutine that takes a MemStats +
+// top-allocator snapshot every interval and keeps the last keep samples
+// in a ring buffer, readable via History and Metrics. Calling StartSampler
+// again first stops any sampler already running.
+func StartSampler(interval time.Duration, keep int) {
+	StopSampler()
+
+	samplerMu.Lock()
+	samplerKeep = keep
+	samplerHistory = nil
+	samplerPrevNumGC = 0
+	stop := make(chan struct{})
+	samplerStop = stop
+	samplerMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				takeSample()
+			}
+		}
+	}()
+}
+
+// StopSampler stops the background sampler started by StartSampler, if any.
+// It is safe to call even if no sampler is running.
+func StopSampler() {
+	samplerMu.Lock()
+	defer samplerMu.Unlock()
+	if samplerStop != nil {
+		close(samplerStop)
+		samplerStop = nil
+	}
+}
+
+const samplerTopN = 10
+
+func takeSample() {
+	var s runtime.MemStats
+	runtime.ReadMemStats(&s)
+
+	samplerMu.Lock()
+	prevNumGC := samplerPrevNumGC
+	samplerPrevNumGC = s.NumGC
+	samplerMu.Unlock()
+
+	gcPause := gcPauseSince(&s, prevNumGC)
+
+	p := aggregatedMemProfile()
+	sort.Sort(byInUseBytes(p))
+	if len(p) > samplerTopN {
+		p = p[:samplerTopN]
+	}
+
+	top := make([]TopStack, 0, len(p))
+	for _, r := range p {
+		top = append(top, TopStack{
+			Stack:        stackStrings(r.Stack()),
+			InUseBytes:   r.InUseBytes(),
+			InUseObjects: r.InUseObjects(),
+		})
+	}
+
+	sample := Sample{
+		Time:        time.Now(),
+		Alloc:       s.Alloc,
+		HeapInuse:   s.HeapInuse,
+		HeapObjects: s.HeapObjects,
+		NextGC:      s.NextGC,
+		NumGC:       s.NumGC,
+		GCPause:     gcPause,
+		Top:         top,
+	}
+
+	samplerMu.Lock()
+	defer samplerMu.Unlock()
+	samplerHistory = append(samplerHistory, sample)
+	if samplerKeep > 0 && len(samplerHistory) > samplerKeep {
+		samplerHistory = samplerHistory[len(samplerHistory)-samplerKeep:]
+	}
+}
+
+// gcPauseSince sums the runtime.MemStats.PauseNs ring buffer entries for the
+// GC cycles completed since prevNumGC, so each Sample's GCPause reflects the
+// pause time accumulated during its own interval rather than just the single
+// most recent pause. PauseNs only retains the last 256 entries, so deltas
+// larger than that are capped.
+func gcPauseSince(s *runtime.MemStats, prevNumGC uint32) time.Duration {
+	delta := s.NumGC - prevNumGC
+	if delta == 0 {
+		return 0
+	}
+	if delta > 256 {
+		delta = 256
+	}
+
+	var total time.Duration
+	for i := uint32(0); i < delta; i++ {
+		idx := (s.NumGC - 1 - i + 256) % 256
+		total += time.Duration(s.PauseNs[idx])
+	}
+	return total
+}
+
+// stackStrings renders a stack trace as one "function file:line" string per
+// frame. Unlike printStackRecord it prints no pc or offset, and frames with
+// no known function are skipped.
+func stackStrings(stk []uintptr) []string {
+	out := make([]string, 0, len(stk))
+	for _, pc := range stk {
+		f := runtime.FuncForPC(pc)
+		if f == nil {
+			continue
+		}
+		file, line := f.FileLine(pc)
+		out = append(out, fmt.Sprintf("%s %s:%d", f.Name(), file, line))
+	}
+	return out
+}
+
+// History writes the sampler's current ring buffer of Samples as a JSON
+// array, oldest first. It is empty until StartSampler has been called.
+func History(w http.ResponseWriter, r *http.Request) {
+	samplerMu.Lock()
+	history := make([]Sample, len(samplerHistory))
+	copy(history, samplerHistory)
+	samplerMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// Metrics writes the most recent sample, if any, in Prometheus text
+// exposition format, as an alternative to the JSON History endpoint.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	samplerMu.Lock()
+	var latest Sample
+	if len(samplerHistory) > 0 {
+		latest = samplerHistory[len(samplerHistory)-1]
+	}
+	samplerMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintf(w, "# HELP bpprof_heap_alloc_bytes Bytes allocated and still in use.\n")
+	fmt.Fprintf(w, "# TYPE bpprof_heap_alloc_bytes gauge\n")
+	fmt.Fprintf(w, "bpprof_heap_alloc_bytes %d\n", latest.Alloc)
+
+	fmt.Fprintf(w, "# HELP bpprof_heap_inuse_bytes Bytes in in-use spans.\n")
+	fmt.Fprintf(w, "# TYPE bpprof_heap_inuse_bytes gauge\n")
+	fmt.Fprintf(w, "bpprof_heap_inuse_bytes %d\n", latest.HeapInuse)
+
+	fmt.Fprintf(w, "# HELP bpprof_heap_objects Number of allocated heap objects.\n")
+	fmt.Fprintf(w, "# TYPE bpprof_heap_objects gauge\n")
+	fmt.Fprintf(w, "bpprof_heap_objects %d\n", latest.HeapObjects)
+
+	fmt.Fprintf(w, "# HELP bpprof_next_gc_bytes Target heap size of the next GC cycle.\n")
+	fmt.Fprintf(w, "# TYPE bpprof_next_gc_bytes gauge\n")
+	fmt.Fprintf(w, "bpprof_next_gc_bytes %d\n", latest.NextGC)
+
+	fmt.Fprintf(w, "# HELP bpprof_num_gc_total Number of completed GC cycles.\n")
+	fmt.Fprintf(w, "# TYPE bpprof_num_gc_total counter\n")
+	fmt.Fprintf(w, "bpprof_num_gc_total %d\n", latest.NumGC)
+
+	fmt.Fprintf(w, "# HELP bpprof_gc_pause_seconds Total GC pause time accumulated since the previous sample.\n")
+	fmt.Fprintf(w, "# TYPE bpprof_gc_pause_seconds gauge\n")
+	fmt.Fprintf(w, "bpprof_gc_pause_seconds %f\n", latest.GCPause.Seconds())
+}
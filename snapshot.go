@@ -0,0 +1,75 @@
+package bpprof
+
+import (
+	"runtime"
+	"sync"
+)
+
+// MaxSnapshots bounds how many named snapshots SaveSnapshot keeps around at
+// once. Once the cap is reached, the oldest snapshot (by insertion order) is
+// evicted to make room for the new one.
+var MaxSnapshots = 16
+
+var (
+	snapshotsMu   sync.Mutex
+	snapshots     = make(map[string]map[uintptr]runtime.MemProfileRecord)
+	snapshotOrder []string
+)
+
+// SaveSnapshot captures the current aggregated heap profile under name, so
+// that it can later be subtracted from a future profile via Heap's
+// ?diff=name query parameter. Calling SaveSnapshot again with the same name
+// overwrites the previous snapshot.
+func SaveSnapshot(name string) {
+	p := aggregatedMemProfile()
+
+	pm := make(map[uintptr]runtime.MemProfileRecord, len(p))
+	for _, r := range p {
+		pm[stack0Hash(r.Stack0)] = r
+	}
+
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+
+	if _, ok := snapshots[name]; !ok {
+		snapshotOrder = append(snapshotOrder, name)
+		if len(snapshotOrder) > MaxSnapshots {
+			oldest := snapshotOrder[0]
+			snapshotOrder = snapshotOrder[1:]
+			delete(snapshots, oldest)
+		}
+	}
+	snapshots[name] = pm
+}
+
+// diffSnapshot subtracts the named snapshot from p, keyed by the same
+// Stack0 hash Heap uses to merge records. Records whose counts don't exceed
+// the snapshot's (i.e. didn't grow) are dropped, and growth-only deltas are
+// returned.
+func diffSnapshot(name string, p []runtime.MemProfileRecord) []runtime.MemProfileRecord {
+	snapshotsMu.Lock()
+	base, ok := snapshots[name]
+	snapshotsMu.Unlock()
+	if !ok {
+		return p
+	}
+
+	out := make([]runtime.MemProfileRecord, 0, len(p))
+	for _, r := range p {
+		h := stack0Hash(r.Stack0)
+		if b, ok := base[h]; ok {
+			r.AllocBytes -= b.AllocBytes
+			r.AllocObjects -= b.AllocObjects
+			r.FreeBytes -= b.FreeBytes
+			r.FreeObjects -= b.FreeObjects
+		}
+		// InUseBytes/InUseObjects are derived from Alloc-Free, so a
+		// non-positive delta here means this stack didn't grow since the
+		// snapshot was taken; drop it.
+		if r.InUseBytes() <= 0 && r.InUseObjects() <= 0 {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}